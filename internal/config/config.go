@@ -0,0 +1,89 @@
+// Package config describes the sandboxes (boxes) and commands that
+// codapi can execute, as loaded from the application's YAML config.
+package config
+
+import "time"
+
+// Config is the top-level application config: the sandboxes available
+// and the commands that can be run in them.
+type Config struct {
+	Boxes    map[string]*Box
+	Commands map[string]map[string]*Command
+}
+
+// A Box describes a sandbox environment: the image it runs, the
+// resources it's allowed to use, and the container runtime backend
+// that should execute it.
+type Box struct {
+	Image    string
+	Versions []string
+	Runtime  string
+	// Backend selects the ContainerRuntime implementation that runs
+	// this box: "docker" (the default), "podman" or "nerdctl".
+	Backend string
+
+	CPU      int
+	Memory   int
+	NProc    int
+	Network  string
+	Storage  string
+	Writable bool
+
+	Volume  string
+	Files   []string
+	Tmpfs   []string
+	CapAdd  []string
+	CapDrop []string
+	Ulimit  []string
+
+	// Pooled keeps a small number of pre-started containers for this
+	// box around, so a step skips the container startup cost.
+	Pooled bool
+	// PoolSize is the number of warm containers to keep ready per
+	// box/version. Defaults to 3 when Pooled is set and PoolSize isn't.
+	PoolSize int
+	// PoolMaxUses is how many requests a pooled container serves
+	// before it's discarded and replaced. Defaults to 50.
+	PoolMaxUses int
+
+	// Build, if set, describes how to build this box's image from a
+	// Dockerfile instead of requiring a prebuilt image.
+	Build *Build
+}
+
+// Build describes how to build a box's image from a Dockerfile.
+type Build struct {
+	// Context is the build context directory. Defaults to ".".
+	Context string
+	// Dockerfile is the Dockerfile path, relative to Context.
+	// Defaults to "Dockerfile".
+	Dockerfile string
+	// Args are passed to the build as --build-arg values.
+	Args map[string]*string
+	// Target is the Dockerfile build stage to build, if any.
+	Target string
+	// Platform is the target platform to build for, if any.
+	Platform string
+}
+
+// A Command is a sequence of steps executed against one or more boxes.
+type Command struct {
+	// Entry is the name of the command's entry point file.
+	// If empty, the command doesn't need request files written to disk.
+	Entry  string
+	Before *Step
+	Steps  []*Step
+	After  *Step
+}
+
+// A Step is a single action (run or exec) performed in a box.
+type Step struct {
+	Box     string
+	Version string
+	User    string
+	Action  string
+	Command []string
+	Stdin   bool
+	Timeout time.Duration
+	NOutput int
+}
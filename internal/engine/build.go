@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+
+	"github.com/nalgeon/codapi/internal/config"
+	"github.com/nalgeon/codapi/internal/logx"
+)
+
+// BuildImages builds the sandbox image for every box in cfg that
+// declares a Build block, so a codapi deployment can describe its
+// sandboxes as Dockerfiles in the repo instead of requiring operators
+// to prebuild images out of band. It's meant to run on startup or
+// from the `codapi build` command.
+func BuildImages(ctx context.Context, cfg *config.Config) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	b := &builder{cli: cli}
+	for name, box := range cfg.Boxes {
+		if box.Build == nil {
+			continue
+		}
+		if err := b.build(ctx, name, box); err != nil {
+			return fmt.Errorf("build box %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// builder drives image builds via the Docker API's ImageBuild,
+// tagging the result the same way a prebuilt box.Image would be.
+type builder struct {
+	cli *client.Client
+}
+
+// build builds (or reuses a cached build of) a single box's image.
+func (b *builder) build(ctx context.Context, name string, box *config.Box) error {
+	archive, hash, err := buildContext(box.Build)
+	if err != nil {
+		return fmt.Errorf("pack build context: %w", err)
+	}
+
+	tags := resultTags(box)
+	cacheTag := box.Image + ":build-" + hash[:12]
+
+	if _, _, err := b.cli.ImageInspectWithRaw(ctx, cacheTag); err == nil {
+		logx.Debug("box %s: build context unchanged (%s), reusing image", name, cacheTag)
+		for _, tag := range tags {
+			if err := b.cli.ImageTag(ctx, cacheTag, tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	opts := types.ImageBuildOptions{
+		Tags:       append([]string{cacheTag}, tags...),
+		Dockerfile: box.Build.Dockerfile,
+		BuildArgs:  box.Build.Args,
+		Target:     box.Build.Target,
+		Platform:   box.Build.Platform,
+		Remove:     true,
+	}
+	resp, err := b.cli.ImageBuild(ctx, archive, opts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return logBuildOutput(name, resp.Body)
+}
+
+// resultTags lists the image:version tags that should point at a
+// freshly built image, so the existing run/exec tagging logic (which
+// picks box.Image or box.Image:version) finds it unchanged.
+func resultTags(box *config.Box) []string {
+	if len(box.Versions) == 0 {
+		return []string{box.Image}
+	}
+	tags := make([]string, len(box.Versions))
+	for i, version := range box.Versions {
+		tags[i] = box.Image + ":" + version
+	}
+	return tags
+}
+
+// logBuildOutput relays the daemon's build log stream through the
+// same logging path as step execution.
+func logBuildOutput(name string, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+		if msg.Stream != "" {
+			logx.Debug("box %s build: %s", name, msg.Stream)
+		}
+	}
+}
+
+// buildContext packs a Build block's context directory into a tar
+// archive for ImageBuild, and returns a content hash of that archive
+// so unchanged build contexts can reuse a previously built image. The
+// hash also covers the Dockerfile path, build args, target and
+// platform, since changing any of those changes the resulting image
+// without necessarily touching a file in the context directory.
+func buildContext(build *config.Build) (io.Reader, string, error) {
+	dir := build.Context
+	if dir == "" {
+		dir = "."
+	}
+
+	var buf bytes.Buffer
+	if err := writeTar(&buf, dir); err != nil {
+		return nil, "", err
+	}
+
+	h := sha256.New()
+	h.Write(buf.Bytes())
+	h.Write([]byte(build.Dockerfile))
+	h.Write([]byte(build.Target))
+	h.Write([]byte(build.Platform))
+	for _, key := range sortedKeys(build.Args) {
+		h.Write([]byte(key))
+		if val := build.Args[key]; val != nil {
+			h.Write([]byte(*val))
+		}
+	}
+
+	return &buf, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sortedKeys returns args's keys in sorted order, so the hash in
+// buildContext doesn't depend on map iteration order.
+func sortedKeys(args map[string]*string) []string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
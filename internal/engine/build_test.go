@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nalgeon/codapi/internal/config"
+)
+
+// TestBuildContextHashTracksBuildFields checks that buildContext's
+// cache hash changes whenever Dockerfile, Args, Target or Platform
+// change, even though none of them live in the context directory -
+// otherwise the builder would keep reusing a stale cached image.
+func TestBuildContextHashTracksBuildFields(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/Dockerfile", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := &config.Build{Context: dir, Dockerfile: "Dockerfile"}
+	_, baseHash, err := buildContext(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arg := "1"
+	variants := []*config.Build{
+		{Context: dir, Dockerfile: "Dockerfile.alt"},
+		{Context: dir, Dockerfile: "Dockerfile", Target: "test"},
+		{Context: dir, Dockerfile: "Dockerfile", Platform: "linux/arm64"},
+		{Context: dir, Dockerfile: "Dockerfile", Args: map[string]*string{"VERSION": &arg}},
+	}
+	for _, v := range variants {
+		_, hash, err := buildContext(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash == baseHash {
+			t.Errorf("buildContext(%+v) hash matches base, expected it to differ", v)
+		}
+	}
+}
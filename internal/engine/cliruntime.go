@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nalgeon/codapi/internal/config"
+	"github.com/nalgeon/codapi/internal/execy"
+)
+
+// cliRuntime implements ContainerRuntime by shelling out to a
+// docker-CLI-compatible binary (podman or nerdctl). Both accept
+// almost the same flags as docker, but not quite: Podman maps
+// rootless containers to a subuid/subgid range instead of the host
+// user namespace, and nerdctl's containerd snapshotters don't support
+// `--storage-opt size=...`, so that flag is passed to Podman only.
+type cliRuntime struct {
+	bin string
+}
+
+func (r *cliRuntime) Create(ctx context.Context, box *config.Box, step *config.Step, req Request, dir string) (string, error) {
+	args := []string{"create", "--name", req.ID}
+	args = append(args, r.boxArgs(box, step.User)...)
+	if dir != "" {
+		args = append(args, "--volume", fmt.Sprintf(box.Volume, dir))
+	}
+	args = append(args, image(box, step, req))
+	args = append(args, expandVars(step.Command, req.ID)...)
+
+	out, _, err := r.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// CreatePooled creates a long-lived container for a box's warm pool,
+// running cmd (normally a sleep-forever placeholder) as root instead
+// of a step's own command and user.
+func (r *cliRuntime) CreatePooled(ctx context.Context, box *config.Box, version string, name string, cmd []string) (string, error) {
+	args := []string{"create", "--name", name}
+	args = append(args, r.boxArgs(box, "root")...)
+	args = append(args, pooledImage(box, version))
+	args = append(args, cmd...)
+
+	out, _, err := r.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *cliRuntime) CopyFiles(ctx context.Context, id string, workdir string, dir string) error {
+	_, _, err := r.run(ctx, "cp", dir+"/.", id+":"+workdir)
+	return err
+}
+
+func (r *cliRuntime) ResetWorkdir(ctx context.Context, id string, workdir string) error {
+	_, _, err := r.run(ctx, "exec", "--user", "root", id, "sh", "-c", fmt.Sprintf("rm -rf %s/*", workdir))
+	return err
+}
+
+func (r *cliRuntime) Start(ctx context.Context, id string) error {
+	_, _, err := r.run(ctx, "start", id)
+	return err
+}
+
+func (r *cliRuntime) Exec(ctx context.Context, id string, step *config.Step, files Files) (string, string, error) {
+	args := []string{"exec"}
+	if step.Stdin {
+		args = append(args, "--interactive")
+	}
+	args = append(args, "--user", step.User, id)
+	args = append(args, expandVars(step.Command, id)...)
+
+	cmd := exec.CommandContext(ctx, r.bin, args...)
+	if step.Stdin {
+		cmd.Stdin = filesReader(files)
+	}
+	var out, errOut limitBuffer
+	out.limit = int64(step.NOutput)
+	errOut.limit = int64(step.NOutput)
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	err := execy.Run(cmd)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// normalize to the package's exit-code error, the same way
+		// dockerRuntime.Exec does, so callers can tell "the command
+		// exited non-zero" from "the exec itself failed"
+		return out.String(), errOut.String(), execExitError{code: exitErr.ExitCode()}
+	}
+	return out.String(), errOut.String(), err
+}
+
+func (r *cliRuntime) Wait(ctx context.Context, id string) (int, error) {
+	out, _, err := r.run(ctx, "wait", id)
+	if err != nil {
+		return 0, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("parse exit code: %w", err)
+	}
+	return code, nil
+}
+
+func (r *cliRuntime) Kill(ctx context.Context, id string) error {
+	_, _, err := r.run(ctx, "kill", id)
+	return err
+}
+
+func (r *cliRuntime) Remove(ctx context.Context, id string) error {
+	_, _, err := r.run(ctx, "rm", "--force", id)
+	return err
+}
+
+func (r *cliRuntime) Logs(ctx context.Context, id string, follow bool) (io.ReadCloser, io.ReadCloser, error) {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	args = append(args, id)
+
+	cmd := exec.CommandContext(ctx, r.bin, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	// cmd.Wait() must run exactly once, and only once both pipes have
+	// been drained and closed by the caller - waiting while one pipe
+	// still has unread output races the process writing to it, and
+	// never waiting at all leaks a zombie.
+	w := &cmdWaiter{cmd: cmd}
+	w.pending.Store(2)
+	return &waitedPipe{ReadCloser: stdout, w: w}, &waitedPipe{ReadCloser: stderr, w: w}, nil
+}
+
+// cmdWaiter calls cmd.Wait() once the last of its pending pipes closes.
+type cmdWaiter struct {
+	cmd     *exec.Cmd
+	pending atomic.Int32
+}
+
+func (w *cmdWaiter) pipeClosed() {
+	if w.pending.Add(-1) == 0 {
+		w.cmd.Wait()
+	}
+}
+
+// waitedPipe wraps one of a cmdWaiter's pipes so closing it counts
+// towards releasing the underlying process.
+type waitedPipe struct {
+	io.ReadCloser
+	w *cmdWaiter
+}
+
+func (p *waitedPipe) Close() error {
+	err := p.ReadCloser.Close()
+	p.w.pipeClosed()
+	return err
+}
+
+func (r *cliRuntime) AttachInput(ctx context.Context, id string, files Files) error {
+	cmd := exec.CommandContext(ctx, r.bin, "attach", "--no-stdin=false", id)
+	cmd.Stdin = filesReader(files)
+	return execy.Run(cmd)
+}
+
+// boxArgs translates a box's config into the CLI flags shared by
+// Create and CreatePooled, skipping the flags each backend doesn't
+// support.
+func (r *cliRuntime) boxArgs(box *config.Box, user string) []string {
+	args := []string{
+		"--runtime", box.Runtime,
+		"--cpus", strconv.Itoa(box.CPU),
+		"--memory", fmt.Sprintf("%dm", box.Memory),
+		"--network", box.Network,
+		"--pids-limit", strconv.Itoa(box.NProc),
+		"--user", user,
+	}
+	if !box.Writable {
+		args = append(args, "--read-only")
+	}
+	if box.Storage != "" && r.bin == backendPodman {
+		// nerdctl's containerd snapshotters don't support a storage
+		// quota flag at all, but Podman's overlay driver does.
+		args = append(args, "--storage-opt", fmt.Sprintf("size=%s", box.Storage))
+	}
+	for _, fs := range box.Tmpfs {
+		args = append(args, "--tmpfs", fs)
+	}
+	for _, cap := range box.CapAdd {
+		args = append(args, "--cap-add", cap)
+	}
+	for _, cap := range box.CapDrop {
+		args = append(args, "--cap-drop", cap)
+	}
+	for _, lim := range box.Ulimit {
+		args = append(args, "--ulimit", lim)
+	}
+	return args
+}
+
+// run executes the CLI binary and collects its stdout/stderr.
+func (r *cliRuntime) run(ctx context.Context, args ...string) (stdout, stderr string, err error) {
+	cmd := exec.CommandContext(ctx, r.bin, args...)
+	var out, errOut strings.Builder
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	err = execy.Run(cmd)
+	return out.String(), errOut.String(), err
+}
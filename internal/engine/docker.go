@@ -2,20 +2,22 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+
 	"github.com/nalgeon/codapi/internal/config"
-	"github.com/nalgeon/codapi/internal/execy"
 	"github.com/nalgeon/codapi/internal/fileio"
 	"github.com/nalgeon/codapi/internal/logx"
 )
@@ -27,8 +29,9 @@ const (
 	actionExec = "exec"
 )
 
-// A Docker engine executes a specific sandbox command
-// using Docker `run` or `exec` actions.
+// A Docker engine executes a specific sandbox command using the `run`
+// or `exec` actions, against whichever ContainerRuntime backend
+// (Docker, Podman, nerdctl) the command's boxes are configured for.
 type Docker struct {
 	cfg *config.Config
 	cmd *config.Command
@@ -163,53 +166,82 @@ func (e *Docker) writeFiles(dir string, files Files) error {
 	return err
 }
 
-// exec executes the step in the docker container
-// using the files from in the temporary directory.
+// exec executes the step in the container, using whichever
+// ContainerRuntime backend the box is configured for.
 func (e *Docker) exec(box *config.Box, step *config.Step, req Request, dir string, files Files) (stdout string, stderr string, err error) {
-	// limit the stdout/stderr size
-	prog := NewProgram(step.Timeout, int64(step.NOutput))
-	args := e.buildArgs(box, step, req, dir)
-
-	if step.Stdin {
-		// pass files to container from stdin
-		stdin := filesReader(files)
-		stdout, stderr, err = prog.RunStdin(stdin, req.ID, "docker", args...)
+	if box.Pooled {
+		return e.execPooled(box, step, req, dir, files)
+	}
+
+	rt, err := runtimeFor(box)
+	if err != nil {
+		err = NewExecutionError("select container runtime", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), step.Timeout)
+	defer cancel()
+
+	var id string
+	if step.Action == actionExec {
+		id = step.Box
 	} else {
-		// pass files to container from temp directory
-		stdout, stderr, err = prog.Run(req.ID, "docker", args...)
+		id, err = rt.Create(ctx, box, step, req, dir)
+		if err != nil {
+			err = NewExecutionError("create container", err)
+			return
+		}
+		defer rt.Remove(context.Background(), id)
+
+		if err = rt.Start(ctx, id); err != nil {
+			err = NewExecutionError("start container", err)
+			return
+		}
+	}
+
+	if step.Stdin && step.Action != actionExec {
+		// for actionExec, stdin goes to the exec session itself
+		// (see e.run/rt.Exec), not the container's main stdin
+		err = rt.AttachInput(ctx, id, files)
+		if err != nil {
+			err = NewExecutionError("attach container input", err)
+			return
+		}
 	}
 
+	stdout, stderr, err = e.run(ctx, rt, id, step, files)
 	if err == nil {
 		// success
 		return
 	}
 
-	if err.Error() == "signal: killed" {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		if step.Action == actionRun {
-			// we have to "docker kill" the container here, because the proccess
-			// inside the container is not related to the "docker run" process,
-			// and will hang forever after the "docker run" process is killed
+			// the command inside the container does not react to the
+			// context cancellation on its own, so kill the container
+			// explicitly - otherwise it keeps running after we give up
 			go func() {
-				err = dockerKill(req.ID)
-				if err == nil {
-					logx.Debug("%s: docker kill ok", req.ID)
+				killCtx, killCancel := context.WithTimeout(context.Background(), killTimeout)
+				defer killCancel()
+				killErr := rt.Kill(killCtx, id)
+				if killErr == nil {
+					logx.Debug("%s: container kill ok", req.ID)
 				} else {
-					logx.Log("%s: docker kill failed: %v", req.ID, err)
+					logx.Log("%s: container kill failed: %v", req.ID, killErr)
 				}
 			}()
 		}
-		// context timeout
 		err = ErrTimeout
 		return
 	}
 
-	exitErr := new(exec.ExitError)
+	var exitErr execExitError
 	if errors.As(err, &exitErr) {
 		// the problem (if any) is the code, not the execution
 		// so we return the error without wrapping into ExecutionError
 		stderr, stdout = stdout+stderr, ""
 		if stderr != "" {
-			err = fmt.Errorf("%s (%s)", stderr, err)
+			err = fmt.Errorf("%s (%s)", stderr, exitErr)
 		}
 		return
 	}
@@ -219,81 +251,195 @@ func (e *Docker) exec(box *config.Box, step *config.Step, req Request, dir strin
 	return
 }
 
-// buildArgs prepares the arguments for the `docker` command.
-func (e *Docker) buildArgs(box *config.Box, step *config.Step, req Request, dir string) []string {
-	var args []string
-	if step.Action == actionRun {
-		args = dockerRunArgs(box, step, req, dir)
-	} else if step.Action == actionExec {
-		args = dockerExecArgs(step)
-	} else {
-		// should never happen if the config is valid
-		args = []string{"version"}
+// execPooled runs a step against a warm, pre-started container instead
+// of paying the create/start cost on every request: it checks a
+// container out of the box's pool, copies the request files in and
+// execs the step's command, then returns the container to the pool
+// (or discards it, per boxPool.checkin) for the next request.
+func (e *Docker) execPooled(box *config.Box, step *config.Step, req Request, dir string, files Files) (stdout string, stderr string, err error) {
+	version := step.Version
+	if version == "" {
+		version = req.Version
+	}
+	bp, err := pools.poolFor(box, version)
+	if err != nil {
+		err = NewExecutionError("select container pool", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), step.Timeout)
+	defer cancel()
+
+	c, err := bp.checkout(ctx)
+	if err != nil {
+		err = NewExecutionError("checkout pooled container", err)
+		return
+	}
+	defer bp.checkin(c)
+
+	if err = bp.rt.CopyFiles(ctx, c.id, bp.workdir, dir); err != nil {
+		err = NewExecutionError("copy files to pooled container", err)
+		return
+	}
+
+	stdout, stderr, err = bp.rt.Exec(ctx, c.id, step, files)
+	if err == nil {
+		return
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ErrTimeout
+		return
+	}
+
+	var exitErr execExitError
+	if errors.As(err, &exitErr) {
+		stderr, stdout = stdout+stderr, ""
+		if stderr != "" {
+			err = fmt.Errorf("%s (%s)", stderr, exitErr)
+		}
+		return
 	}
 
-	command := expandVars(step.Command, req.ID)
-	args = append(args, command...)
-	logx.Debug("%v", args)
-	return args
+	err = NewExecutionError("execute code", err)
+	return
 }
 
-// buildArgs prepares the arguments for the `docker run` command.
-func dockerRunArgs(box *config.Box, step *config.Step, req Request, dir string) []string {
-	args := []string{
-		actionRun, "--rm",
-		"--name", req.ID,
-		"--runtime", box.Runtime,
-		"--cpus", strconv.Itoa(box.CPU),
-		"--memory", fmt.Sprintf("%dm", box.Memory),
-		"--network", box.Network,
-		"--pids-limit", strconv.Itoa(box.NProc),
-		"--user", step.User,
+// containerConfig builds the container.Config for a step.
+func containerConfig(box *config.Box, step *config.Step, req Request) *container.Config {
+	return &container.Config{
+		Image:       image(box, step, req),
+		Cmd:         expandVars(step.Command, req.ID),
+		User:        step.User,
+		OpenStdin:   step.Stdin,
+		AttachStdin: step.Stdin,
+		StdinOnce:   step.Stdin,
 	}
-	if !box.Writable {
-		args = append(args, "--read-only")
+}
+
+// image picks the image:version to run, preferring the step's pinned
+// version, then the request's version, then the box's latest image.
+func image(box *config.Box, step *config.Step, req Request) string {
+	if step.Version != "" {
+		return box.Image + ":" + step.Version
+	}
+	if req.Version != "" {
+		return box.Image + ":" + req.Version
 	}
-	if step.Stdin {
-		args = append(args, "--interactive")
+	return box.Image
+}
+
+// hostConfig builds the container.HostConfig for a box,
+// mirroring the flags that dockerRunArgs used to pass to the CLI.
+func hostConfig(box *config.Box, dir string) (*container.HostConfig, error) {
+	hostCfg := &container.HostConfig{
+		AutoRemove:     false, // we remove explicitly after reading the logs
+		Runtime:        box.Runtime,
+		NetworkMode:    container.NetworkMode(box.Network),
+		ReadonlyRootfs: !box.Writable,
+		Resources: container.Resources{
+			NanoCPUs:  int64(box.CPU) * 1e9,
+			Memory:    int64(box.Memory) * 1024 * 1024,
+			PidsLimit: int64Ptr(int64(box.NProc)),
+			CapAdd:    box.CapAdd,
+			CapDrop:   box.CapDrop,
+		},
 	}
 	if box.Storage != "" {
-		args = append(args, "--storage-opt", fmt.Sprintf("size=%s", box.Storage))
+		hostCfg.StorageOpt = map[string]string{"size": box.Storage}
 	}
-	if dir != "" {
-		args = append(args, "--volume", fmt.Sprintf(box.Volume, dir))
+	if len(box.Tmpfs) > 0 {
+		hostCfg.Tmpfs = make(map[string]string, len(box.Tmpfs))
+		for _, fs := range box.Tmpfs {
+			target, opts, _ := strings.Cut(fs, ":")
+			hostCfg.Tmpfs[target] = opts
+		}
+	}
+	for _, lim := range box.Ulimit {
+		u, err := parseUlimit(lim)
+		if err != nil {
+			return nil, err
+		}
+		hostCfg.Ulimits = append(hostCfg.Ulimits, u)
 	}
-	for _, fs := range box.Tmpfs {
-		args = append(args, "--tmpfs", fs)
+	if dir != "" {
+		m, err := parseBindMount(fmt.Sprintf(box.Volume, dir))
+		if err != nil {
+			return nil, err
+		}
+		hostCfg.Mounts = []mount.Mount{m}
 	}
-	for _, cap := range box.CapAdd {
-		args = append(args, "--cap-add", cap)
+	return hostCfg, nil
+}
+
+// parseBindMount turns a docker-cli-style `source:target[:mode]` spec
+// (the already-formatted box.Volume) into a mount.Mount, so that
+// existing box configs keep working unchanged.
+func parseBindMount(spec string) (mount.Mount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 {
+		return mount.Mount{}, fmt.Errorf("invalid volume spec %q", spec)
 	}
-	for _, cap := range box.CapDrop {
-		args = append(args, "--cap-drop", cap)
+	m := mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   parts[0],
+		Target:   parts[1],
+		ReadOnly: len(parts) > 2 && parts[2] == "ro",
 	}
-	for _, lim := range box.Ulimit {
-		args = append(args, "--ulimit", lim)
+	return m, nil
+}
+
+// run execs into the container for exec actions; otherwise it waits
+// for the already-started container to finish and then collects its
+// stdout/stderr, capped at step.NOutput bytes each.
+func (e *Docker) run(ctx context.Context, rt ContainerRuntime, id string, step *config.Step, files Files) (string, string, error) {
+	if step.Action == actionExec {
+		return rt.Exec(ctx, id, step, files)
 	}
 
-	if step.Version != "" {
-		// if the version is set in the step config, use it
-		args = append(args, box.Image+":"+step.Version)
-	} else if req.Version != "" {
-		// if the version is set in the request, use it
-		args = append(args, box.Image+":"+req.Version)
-	} else {
-		// otherwise, use the latest version
-		args = append(args, box.Image)
+	code, err := rt.Wait(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	stdout, stderr, err := e.containerLogs(ctx, rt, id, step.NOutput)
+	if err != nil {
+		return stdout, stderr, err
 	}
-	return args
+	if code != 0 {
+		return stdout, stderr, execExitError{code: code}
+	}
+	return stdout, stderr, nil
 }
 
-// dockerExecArgs prepares the arguments for the `docker exec` command.
-func dockerExecArgs(step *config.Step) []string {
-	return []string{
-		actionExec, "--interactive",
-		"--user", step.User,
-		step.Box,
+// containerLogs fetches the container's stdout/stderr, each capped
+// at nOutput bytes.
+func (e *Docker) containerLogs(ctx context.Context, rt ContainerRuntime, id string, nOutput int) (string, string, error) {
+	stdoutR, stderrR, err := rt.Logs(ctx, id, false)
+	if err != nil {
+		return "", "", err
+	}
+	defer stdoutR.Close()
+	defer stderrR.Close()
+
+	var stdout, stderr limitBuffer
+	stdout.limit = int64(nOutput)
+	stderr.limit = int64(nOutput)
+	// drain both streams at once: a runtime may feed them from a single
+	// demultiplexed source, so reading one to the end first can block
+	errDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&stderr, stderrR)
+		errDone <- err
+	}()
+	_, outErr := io.Copy(&stdout, stdoutR)
+	errErr := <-errDone
+	if outErr != nil && outErr != io.EOF {
+		return stdout.String(), stderr.String(), outErr
 	}
+	if errErr != nil && errErr != io.EOF {
+		return stdout.String(), stderr.String(), errErr
+	}
+	return stdout.String(), stderr.String(), nil
 }
 
 // filesReader creates a reader over an in-memory collection of files.
@@ -316,10 +462,55 @@ func expandVars(command []string, name string) []string {
 	return expanded
 }
 
-// dockerKill kills the container with the specified id/name.
-func dockerKill(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "docker", "kill", id)
-	return execy.Run(cmd)
+// execExitError reports a non-zero exit code from a container or exec,
+// standing in for exec.ExitError so that the Docker API backend and the
+// CLI backends (which map exec.ExitError to it) report exit codes alike.
+type execExitError struct {
+	code int
+}
+
+func (e execExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// limitBuffer is a bytes.Buffer that silently stops accepting writes
+// once it reaches limit bytes, the same capping that step.NOutput
+// used to apply to the CLI subprocess output.
+type limitBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.Len()) >= b.limit {
+		return len(p), nil
+	}
+	if b.limit > 0 && int64(b.Len())+int64(len(p)) > b.limit {
+		p = p[:b.limit-int64(b.Len())]
+	}
+	return b.Buffer.Write(p)
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func parseUlimit(spec string) (*container.Ulimit, error) {
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid ulimit %q", spec)
+	}
+	soft, hard, ok := strings.Cut(rest, ":")
+	if !ok {
+		hard = soft
+	}
+	softVal, err := strconv.ParseInt(soft, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ulimit %q: %w", spec, err)
+	}
+	hardVal, err := strconv.ParseInt(hard, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ulimit %q: %w", spec, err)
+	}
+	return &container.Ulimit{Name: name, Soft: softVal, Hard: hardVal}, nil
 }
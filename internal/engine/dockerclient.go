@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/client"
+)
+
+var (
+	sharedClient     *client.Client
+	sharedClientErr  error
+	sharedClientOnce sync.Once
+)
+
+// dockerClient returns the process-wide Docker API client, dialing it
+// lazily on first use and reusing it for every subsequent request
+// instead of spawning a `docker` subprocess per call.
+//
+// DOCKER_HOST is honored as usual, including ssh:// hosts, which are
+// routed through a connection helper the same way the docker CLI does.
+func dockerClient() (*client.Client, error) {
+	sharedClientOnce.Do(func() {
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+		if host := dockerHost(); strings.HasPrefix(host, "ssh://") {
+			helper, err := connhelper.GetConnectionHelper(host)
+			if err != nil {
+				sharedClientErr = err
+				return
+			}
+			opts = append(opts,
+				client.WithHost(helper.Host),
+				client.WithDialContext(helper.Dialer),
+			)
+		}
+		sharedClient, sharedClientErr = client.NewClientWithOpts(opts...)
+	})
+	return sharedClient, sharedClientErr
+}
+
+func dockerHost() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	return client.DefaultDockerHost
+}
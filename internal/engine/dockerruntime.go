@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/nalgeon/codapi/internal/config"
+)
+
+// dockerRuntime implements ContainerRuntime against a real Docker
+// daemon via the Engine API client.
+type dockerRuntime struct {
+	cli *client.Client
+}
+
+func (r *dockerRuntime) Create(ctx context.Context, box *config.Box, step *config.Step, req Request, dir string) (string, error) {
+	cfg := containerConfig(box, step, req)
+	hostCfg, err := hostConfig(box, dir)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.cli.ContainerCreate(ctx, cfg, hostCfg, nil, nil, req.ID)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// CreatePooled creates a long-lived container for a box's warm pool.
+// It reuses the box's regular host config (resources, capabilities,
+// read-only rootfs, ...) but skips the per-request bind mount, since
+// a pooled container receives its files via CopyFiles instead.
+func (r *dockerRuntime) CreatePooled(ctx context.Context, box *config.Box, version string, name string, cmd []string) (string, error) {
+	cfg := &container.Config{
+		Image: pooledImage(box, version),
+		Cmd:   cmd,
+		User:  "root",
+	}
+	hostCfg, err := hostConfig(box, "")
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.cli.ContainerCreate(ctx, cfg, hostCfg, nil, nil, name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (r *dockerRuntime) Start(ctx context.Context, id string) error {
+	return r.cli.ContainerStart(ctx, id, container.StartOptions{})
+}
+
+func (r *dockerRuntime) Exec(ctx context.Context, id string, step *config.Step, files Files) (string, string, error) {
+	execCfg := container.ExecOptions{
+		Cmd:          expandVars(step.Command, id),
+		User:         step.User,
+		AttachStdout: true,
+		AttachStderr: true,
+		AttachStdin:  step.Stdin,
+	}
+	created, err := r.cli.ContainerExecCreate(ctx, id, execCfg)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := r.cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Close()
+
+	if step.Stdin {
+		// the exec session has its own stdin, separate from the
+		// container's main one - write the request files there,
+		// not via AttachInput
+		if _, err := io.Copy(resp.Conn, filesReader(files)); err != nil {
+			return "", "", err
+		}
+		resp.CloseWrite()
+	}
+
+	var stdout, stderr limitBuffer
+	stdout.limit = int64(step.NOutput)
+	stderr.limit = int64(step.NOutput)
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil && err != io.EOF {
+		return stdout.String(), stderr.String(), err
+	}
+
+	inspect, err := r.cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return stdout.String(), stderr.String(), err
+	}
+	if inspect.ExitCode != 0 {
+		return stdout.String(), stderr.String(), execExitError{code: inspect.ExitCode}
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+func (r *dockerRuntime) Wait(ctx context.Context, id string) (int, error) {
+	waitCh, errCh := r.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case err := <-errCh:
+		return 0, err
+	case status := <-waitCh:
+		return int(status.StatusCode), nil
+	}
+}
+
+func (r *dockerRuntime) Kill(ctx context.Context, id string) error {
+	return r.cli.ContainerKill(ctx, id, "KILL")
+}
+
+func (r *dockerRuntime) Remove(ctx context.Context, id string) error {
+	return r.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+}
+
+// Logs fetches the container's combined log stream and demultiplexes
+// it into separate stdout/stderr pipes, since the Engine API (unlike
+// the docker CLI) returns both interleaved in one framed stream.
+func (r *dockerRuntime) Logs(ctx context.Context, id string, follow bool) (io.ReadCloser, io.ReadCloser, error) {
+	rc, err := r.cli.ContainerLogs(ctx, id, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: follow})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	go func() {
+		defer rc.Close()
+		_, err := stdcopy.StdCopy(outW, errW, rc)
+		outW.CloseWithError(err)
+		errW.CloseWithError(err)
+	}()
+	return outR, errR, nil
+}
+
+// CopyFiles uploads dir's contents into the container's workdir via
+// the Engine API, the equivalent of `docker cp dir/. id:workdir`.
+func (r *dockerRuntime) CopyFiles(ctx context.Context, id string, workdir string, dir string) error {
+	archive, err := tarDir(dir)
+	if err != nil {
+		return err
+	}
+	return r.cli.CopyToContainer(ctx, id, workdir, archive, types.CopyToContainerOptions{})
+}
+
+// ResetWorkdir clears a pooled container's workdir between checkouts.
+func (r *dockerRuntime) ResetWorkdir(ctx context.Context, id string, workdir string) error {
+	execCfg := container.ExecOptions{
+		Cmd:  []string{"sh", "-c", fmt.Sprintf("rm -rf %s/*", workdir)},
+		User: "root",
+	}
+	created, err := r.cli.ContainerExecCreate(ctx, id, execCfg)
+	if err != nil {
+		return err
+	}
+	return r.cli.ContainerExecStart(ctx, created.ID, container.ExecStartOptions{})
+}
+
+// tarDir packs a directory's files into a tar archive, which is the
+// format CopyToContainer expects.
+func tarDir(dir string) (io.Reader, error) {
+	var buf bytes.Buffer
+	if err := writeTar(&buf, dir); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// writeTar tars dir's files (recursively) onto w.
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: rel, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// pooledImage picks the image:version that backs a box's warm pool.
+func pooledImage(box *config.Box, version string) string {
+	if version != "" {
+		return box.Image + ":" + version
+	}
+	return box.Image
+}
+
+func (r *dockerRuntime) AttachInput(ctx context.Context, id string, files Files) error {
+	resp, err := r.cli.ContainerAttach(ctx, id, container.AttachOptions{Stream: true, Stdin: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if _, err := io.Copy(resp.Conn, filesReader(files)); err != nil {
+		return err
+	}
+	return resp.CloseWrite()
+}
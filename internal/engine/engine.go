@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Engine executes a sandbox command against a request.
+type Engine interface {
+	// Exec runs the command and returns its result once it finishes.
+	Exec(req Request) Execution
+	// ExecStream runs the command's Before step and its first step,
+	// streaming the first step's stdout/stderr to out/errOut as they are
+	// produced instead of buffering them. Unlike Exec, it does not run
+	// the remaining steps or the After step.
+	ExecStream(req Request, out io.Writer, errOut io.Writer) Execution
+}
+
+// Request is a single request to run a sandbox command.
+type Request struct {
+	// ID identifies the request, and is used to name the container
+	// that runs it.
+	ID string
+	// Version picks which of the box's supported versions to run,
+	// defaulting to the box's own latest version if empty.
+	Version string
+	// Files holds the request's input files.
+	Files Files
+}
+
+// Files holds a request's input files, keyed by name. An empty name
+// refers to the command's entry point file (config.Command.Entry).
+type Files map[string]string
+
+// Range calls fn for every file, stopping early if fn returns false.
+func (f Files) Range(fn func(name, content string) bool) {
+	for name, content := range f {
+		if !fn(name, content) {
+			return
+		}
+	}
+}
+
+// Execution is the result of running a request's command.
+type Execution struct {
+	ID     string
+	OK     bool
+	Stdout string
+	Stderr string
+}
+
+// Fail builds a failed Execution for a request, reporting err as its
+// Stderr so a caller that only renders Stdout/Stderr still sees why
+// the request failed.
+func Fail(id string, err error) Execution {
+	return Execution{ID: id, OK: false, Stderr: err.Error()}
+}
+
+// ErrTimeout is returned when a step runs longer than its configured
+// Timeout.
+var ErrTimeout = errors.New("execution timed out")
+
+// ExecutionError wraps a failure that happened while preparing or
+// running a step (as opposed to the step's command itself returning a
+// non-zero exit code, which is reported via Execution, not an error).
+type ExecutionError struct {
+	Op  string
+	Err error
+}
+
+// NewExecutionError wraps err with the operation that failed.
+func NewExecutionError(op string, err error) error {
+	return &ExecutionError{Op: op, Err: err}
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ServeExecStream runs req against eng and streams its stdout/stderr
+// to w as server-sent events (one "stdout"/"stderr" event per write),
+// giving ExecStream an HTTP entry point instead of only being callable
+// from within the package.
+func ServeExecStream(w http.ResponseWriter, eng Engine, req Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// out and errOut are written from separate goroutines in
+	// Docker.execStepStream, but both ultimately write to the same
+	// http.ResponseWriter, which isn't safe for concurrent writes -
+	// share one mutex between the two sseWriters to serialize them.
+	var mu sync.Mutex
+	out := &sseWriter{w: w, flusher: flusher, mu: &mu, event: "stdout"}
+	errOut := &sseWriter{w: w, flusher: flusher, mu: &mu, event: "stderr"}
+
+	result := eng.ExecStream(req, out, errOut)
+	if !result.OK {
+		mu.Lock()
+		writeSSE(w, "error", []byte(result.Stderr))
+		flusher.Flush()
+		mu.Unlock()
+	}
+}
+
+// sseWriter turns each Write into a single server-sent event, flushing
+// immediately so the client sees output as it's produced. mu is shared
+// with the writer's sibling stream so the two never interleave writes
+// to the underlying http.ResponseWriter.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mu      *sync.Mutex
+	event   string
+}
+
+func (s *sseWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeSSE(s.w, s.event, p); err != nil {
+		return 0, err
+	}
+	s.flusher.Flush()
+	return len(p), nil
+}
+
+// writeSSE writes p as a single SSE event named name. Per the SSE
+// spec, a multi-line payload needs a "data: " prefix on every line, or
+// an EventSource client silently drops everything past the first line.
+func writeSSE(w http.ResponseWriter, name string, p []byte) error {
+	if _, err := fmt.Fprintf(w, "event: %s\n", name); err != nil {
+		return err
+	}
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "\n")
+	return err
+}
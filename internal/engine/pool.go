@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nalgeon/codapi/internal/config"
+	"github.com/nalgeon/codapi/internal/logx"
+)
+
+// Defaults used when a pooled box doesn't set PoolSize/PoolMaxUses.
+const (
+	defaultPoolSize    = 3
+	defaultPoolMaxUses = 50
+)
+
+// sleepForever is the entrypoint a pooled container runs so it stays
+// up between checkouts, waiting to be `exec`'d into.
+var sleepForever = []string{"sh", "-c", "while true; do sleep 3600; done"}
+
+// pools is the process-wide set of warm container pools, one per
+// box/version that opts into pooling.
+var pools = newPools()
+
+// pooled is a checked-out warm container and how many times it's
+// been used so far.
+type pooled struct {
+	id   string
+	uses int
+}
+
+// boxPool keeps a small number of pre-started containers for one
+// box/version around, so a pooled step skips the `docker run` startup
+// cost on every request.
+type boxPool struct {
+	box     *config.Box
+	version string
+	rt      ContainerRuntime
+	workdir string
+	size    int
+	maxUses int
+
+	mu      sync.Mutex
+	ready   []*pooled
+	closed  bool
+	filling bool
+}
+
+// Pools manages the boxPools keyed by box image + version.
+type Pools struct {
+	mu   sync.Mutex
+	byID map[string]*boxPool
+}
+
+func newPools() *Pools {
+	return &Pools{byID: make(map[string]*boxPool)}
+}
+
+// poolFor returns the boxPool for a box/version, creating and
+// starting to fill it on first use.
+func (p *Pools) poolFor(box *config.Box, version string) (*boxPool, error) {
+	key := box.Image + ":" + version
+
+	p.mu.Lock()
+	bp, ok := p.byID[key]
+	if ok {
+		p.mu.Unlock()
+		return bp, nil
+	}
+
+	rt, err := runtimeFor(box)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	wd, err := workdir(box)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	size := box.PoolSize
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	maxUses := box.PoolMaxUses
+	if maxUses <= 0 {
+		maxUses = defaultPoolMaxUses
+	}
+
+	bp = &boxPool{box: box, version: version, rt: rt, workdir: wd, size: size, maxUses: maxUses}
+	p.byID[key] = bp
+	p.mu.Unlock()
+
+	go bp.refill()
+	return bp, nil
+}
+
+// Drain stops refilling every pool and removes all of their
+// containers, so no orphans are left behind on shutdown.
+func (p *Pools) Drain(ctx context.Context) {
+	p.mu.Lock()
+	boxPools := make([]*boxPool, 0, len(p.byID))
+	for _, bp := range p.byID {
+		boxPools = append(boxPools, bp)
+	}
+	p.mu.Unlock()
+
+	for _, bp := range boxPools {
+		bp.drain(ctx)
+	}
+}
+
+// checkout takes a ready container out of the pool, spawning one
+// synchronously if the pool is momentarily empty so the request isn't
+// blocked on the background refiller.
+func (bp *boxPool) checkout(ctx context.Context) (*pooled, error) {
+	bp.mu.Lock()
+	if n := len(bp.ready); n > 0 {
+		c := bp.ready[n-1]
+		bp.ready = bp.ready[:n-1]
+		bp.mu.Unlock()
+		go bp.refill()
+		return c, nil
+	}
+	bp.mu.Unlock()
+
+	return bp.spawn(ctx)
+}
+
+// checkin returns a container to the pool, resetting its workdir for
+// reuse, or discards it (and triggers a refill) once it's been used
+// maxUses times.
+func (bp *boxPool) checkin(c *pooled) {
+	c.uses++
+	if c.uses >= bp.maxUses {
+		bp.discard(c)
+		go bp.refill()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := bp.rt.ResetWorkdir(ctx, c.id, bp.workdir); err != nil {
+		logx.Log("pool %s: reset workdir failed, discarding container: %v", bp.box.Image, err)
+		bp.discard(c)
+		go bp.refill()
+		return
+	}
+
+	bp.mu.Lock()
+	if bp.closed {
+		bp.mu.Unlock()
+		bp.discard(c)
+		return
+	}
+	bp.ready = append(bp.ready, c)
+	bp.mu.Unlock()
+}
+
+// discard removes a container for good, without returning it to the pool.
+func (bp *boxPool) discard(c *pooled) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := bp.rt.Remove(ctx, c.id); err != nil {
+		logx.Log("pool %s: remove container failed: %v", bp.box.Image, err)
+	}
+}
+
+// spawn creates, starts and names a fresh pooled container.
+func (bp *boxPool) spawn(ctx context.Context) (*pooled, error) {
+	name := fmt.Sprintf("pool-%s-%s-%d", bp.box.Image, bp.version, time.Now().UnixNano())
+	id, err := bp.rt.CreatePooled(ctx, bp.box, bp.version, name, sleepForever)
+	if err != nil {
+		return nil, fmt.Errorf("spawn pooled container: %w", err)
+	}
+	if err := bp.rt.Start(ctx, id); err != nil {
+		// the container exists but never started - remove it so a
+		// Start failure doesn't leak it the way an orphaned drain would
+		removeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if removeErr := bp.rt.Remove(removeCtx, id); removeErr != nil {
+			logx.Log("pool %s: remove container after failed start: %v", bp.box.Image, removeErr)
+		}
+		return nil, fmt.Errorf("start pooled container: %w", err)
+	}
+	return &pooled{id: id}, nil
+}
+
+// refill tops the pool back up to its configured size. Only one
+// refill runs at a time per pool; callers that find a refill already
+// in progress just return.
+func (bp *boxPool) refill() {
+	bp.mu.Lock()
+	if bp.filling || bp.closed {
+		bp.mu.Unlock()
+		return
+	}
+	bp.filling = true
+	bp.mu.Unlock()
+
+	defer func() {
+		bp.mu.Lock()
+		bp.filling = false
+		bp.mu.Unlock()
+	}()
+
+	for {
+		bp.mu.Lock()
+		short := bp.size - len(bp.ready)
+		closed := bp.closed
+		bp.mu.Unlock()
+		if short <= 0 || closed {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		c, err := bp.spawn(ctx)
+		cancel()
+		if err != nil {
+			logx.Log("pool %s: refill failed: %v", bp.box.Image, err)
+			return
+		}
+
+		bp.mu.Lock()
+		if bp.closed {
+			bp.mu.Unlock()
+			bp.discard(c)
+			return
+		}
+		bp.ready = append(bp.ready, c)
+		bp.mu.Unlock()
+	}
+}
+
+// drain stops this pool from refilling and removes every ready container.
+func (bp *boxPool) drain(ctx context.Context) {
+	bp.mu.Lock()
+	bp.closed = true
+	ready := bp.ready
+	bp.ready = nil
+	bp.mu.Unlock()
+
+	for _, c := range ready {
+		if err := bp.rt.Remove(ctx, c.id); err != nil {
+			logx.Log("pool %s: drain remove failed: %v", bp.box.Image, err)
+		}
+	}
+}
+
+// workdir reports the directory inside the container that request
+// files are mounted at, derived from the box's existing volume spec
+// so pooled containers can copy files to the same place.
+func workdir(box *config.Box) (string, error) {
+	m, err := parseBindMount(fmt.Sprintf(box.Volume, os.TempDir()))
+	if err != nil {
+		return "", err
+	}
+	return m.Target, nil
+}
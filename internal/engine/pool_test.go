@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nalgeon/codapi/internal/config"
+)
+
+// fakeRuntime is a ContainerRuntime that never touches a real daemon,
+// so boxPool's checkout/checkin/drain bookkeeping can be tested without
+// one.
+type fakeRuntime struct {
+	nextID  int64
+	removed int32
+}
+
+func (r *fakeRuntime) Create(ctx context.Context, box *config.Box, step *config.Step, req Request, dir string) (string, error) {
+	return "", nil
+}
+
+func (r *fakeRuntime) CreatePooled(ctx context.Context, box *config.Box, version string, name string, cmd []string) (string, error) {
+	id := atomic.AddInt64(&r.nextID, 1)
+	return fmt.Sprintf("c%d", id), nil
+}
+
+func (r *fakeRuntime) Start(ctx context.Context, id string) error { return nil }
+
+func (r *fakeRuntime) Exec(ctx context.Context, id string, step *config.Step, files Files) (string, string, error) {
+	return "", "", nil
+}
+
+func (r *fakeRuntime) CopyFiles(ctx context.Context, id string, workdir string, dir string) error {
+	return nil
+}
+
+func (r *fakeRuntime) ResetWorkdir(ctx context.Context, id string, workdir string) error { return nil }
+
+func (r *fakeRuntime) Wait(ctx context.Context, id string) (int, error) { return 0, nil }
+
+func (r *fakeRuntime) Kill(ctx context.Context, id string) error { return nil }
+
+func (r *fakeRuntime) Remove(ctx context.Context, id string) error {
+	atomic.AddInt32(&r.removed, 1)
+	return nil
+}
+
+func (r *fakeRuntime) Logs(ctx context.Context, id string, follow bool) (io.ReadCloser, io.ReadCloser, error) {
+	return nil, nil, nil
+}
+
+func (r *fakeRuntime) AttachInput(ctx context.Context, id string, files Files) error { return nil }
+
+// TestCheckinDrainRace checks in a container concurrently with draining
+// the pool. Before the fix, checkin read bp.closed and appended to
+// bp.ready in two separate critical sections, so a drain landing
+// between them could re-add a container to bp.ready after the drain
+// already cleared it - an orphan that's never removed. Run with
+// -race to also catch any unsynchronized access to bp.ready.
+func TestCheckinDrainRace(t *testing.T) {
+	rt := &fakeRuntime{}
+	bp := &boxPool{
+		box:     &config.Box{Image: "test"},
+		rt:      rt,
+		workdir: "/tmp/x",
+		size:    1,
+		maxUses: 1000,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		c := &pooled{id: fmt.Sprintf("c%d", i)}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bp.checkin(c)
+		}()
+		go func() {
+			defer wg.Done()
+			bp.drain(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	bp.mu.Lock()
+	ready := bp.ready
+	closed := bp.closed
+	bp.mu.Unlock()
+
+	if !closed {
+		t.Fatal("expected pool to end up closed")
+	}
+	if len(ready) != 0 {
+		t.Fatalf("drain left %d containers stranded in bp.ready", len(ready))
+	}
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/nalgeon/codapi/internal/config"
+)
+
+// Supported values for config.Box.Backend. Docker is the default,
+// so existing box configs that don't set Backend keep working unchanged.
+const (
+	backendDocker  = "docker"
+	backendPodman  = "podman"
+	backendNerdctl = "nerdctl"
+)
+
+// ContainerRuntime abstracts the handful of container lifecycle
+// operations the Docker engine needs, so that a box can run against
+// Podman or nerdctl instead of requiring a Docker daemon.
+type ContainerRuntime interface {
+	// Create creates (but does not start) the sandbox container
+	// for a step and returns its id.
+	Create(ctx context.Context, box *config.Box, step *config.Step, req Request, dir string) (id string, err error)
+	// CreatePooled creates (but does not start) a long-lived container
+	// for a box's warm pool, running cmd as its entrypoint instead of
+	// the step's command - normally a sleep-forever placeholder so the
+	// container stays up between checkouts.
+	CreatePooled(ctx context.Context, box *config.Box, version string, name string, cmd []string) (id string, err error)
+	// Start starts a previously created container.
+	Start(ctx context.Context, id string) error
+	// Exec runs a step's command inside an already-running container
+	// (the `exec` action, e.g. against a pooled container). If
+	// step.Stdin is set, files is streamed to the exec session's own
+	// stdin, not the container's main stdin.
+	Exec(ctx context.Context, id string, step *config.Step, files Files) (stdout, stderr string, err error)
+	// CopyFiles copies dir's contents into the container's workdir,
+	// the pooled-container equivalent of the bind-mounted temp dir.
+	CopyFiles(ctx context.Context, id string, workdir string, dir string) error
+	// ResetWorkdir clears the container's workdir so a pooled
+	// container can be reused by the next request.
+	ResetWorkdir(ctx context.Context, id string, workdir string) error
+	// Wait blocks until the container exits and returns its exit code.
+	Wait(ctx context.Context, id string) (code int, err error)
+	// Kill sends a kill signal to a running container.
+	Kill(ctx context.Context, id string) error
+	// Remove removes a container, forcing removal if still running.
+	Remove(ctx context.Context, id string) error
+	// Logs returns the container's stdout and stderr as separate
+	// streams, following new output as it's produced when follow is true.
+	Logs(ctx context.Context, id string, follow bool) (stdout, stderr io.ReadCloser, err error)
+	// AttachInput streams files to the container's stdin.
+	AttachInput(ctx context.Context, id string, files Files) error
+}
+
+// runtimeFor picks the ContainerRuntime backend for a box, defaulting
+// to Docker when box.Backend isn't set.
+func runtimeFor(box *config.Box) (ContainerRuntime, error) {
+	switch box.Backend {
+	case "", backendDocker:
+		cli, err := dockerClient()
+		if err != nil {
+			return nil, err
+		}
+		return &dockerRuntime{cli: cli}, nil
+	case backendPodman:
+		return &cliRuntime{bin: backendPodman}, nil
+	case backendNerdctl:
+		return &cliRuntime{bin: backendNerdctl}, nil
+	default:
+		return nil, fmt.Errorf("unknown container backend %q", box.Backend)
+	}
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/nalgeon/codapi/internal/config"
+)
+
+// ExecStream executes the command's Before step and then its first
+// step, streaming the first step's stdout/stderr to out/errOut as they
+// are produced, instead of buffering them until the container exits.
+// Unlike Exec, it does not run the remaining steps or the After step.
+// This is meant for
+// long-running steps (a REPL, a training loop, a web server) where
+// waiting for completion would otherwise give the caller nothing.
+func (e *Docker) ExecStream(req Request, out io.Writer, errOut io.Writer) Execution {
+	dir, err := os.MkdirTemp("", "")
+	if err != nil {
+		err = NewExecutionError("create temp dir", err)
+		return Fail(req.ID, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if e.cmd.Entry != "" {
+		err = e.writeFiles(dir, req.Files)
+		if err != nil {
+			err = NewExecutionError("write files to temp dir", err)
+			return Fail(req.ID, err)
+		}
+	}
+
+	if e.cmd.Before != nil {
+		beforeOut := e.execStep(e.cmd.Before, req, dir, nil)
+		if !beforeOut.OK {
+			return beforeOut
+		}
+	}
+
+	first := e.cmd.Steps[0]
+	return e.execStepStream(first, req, dir, req.Files, out, errOut)
+}
+
+// execStepStream runs a single step the way execStep does, but pipes
+// the container's output to out/errOut live instead of returning it
+// only after the container exits.
+func (e *Docker) execStepStream(step *config.Step, req Request, dir string, files Files, out io.Writer, errOut io.Writer) Execution {
+	box := e.cfg.Boxes[step.Box]
+	if err := e.validateVersion(box, step, req); err != nil {
+		return Fail(req.ID, err)
+	}
+	if err := e.copyFiles(box, dir); err != nil {
+		return Fail(req.ID, NewExecutionError("copy files to temp dir", err))
+	}
+
+	rt, err := runtimeFor(box)
+	if err != nil {
+		return Fail(req.ID, NewExecutionError("select container runtime", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), step.Timeout)
+	defer cancel()
+
+	if step.Action == actionExec {
+		// exec into the named, already-running container instead of
+		// creating a new one - same as Docker.exec does for exec steps. The
+		// runtime doesn't support streaming an exec session's output
+		// live, so the step's full output is written to out/errOut
+		// once the command finishes.
+		return e.execStreamInto(ctx, rt, step, req, files, out, errOut)
+	}
+
+	id, err := rt.Create(ctx, box, step, req, dir)
+	if err != nil {
+		return Fail(req.ID, NewExecutionError("create container", err))
+	}
+	defer rt.Remove(context.Background(), id)
+
+	if err := rt.Start(ctx, id); err != nil {
+		return Fail(req.ID, NewExecutionError("start container", err))
+	}
+
+	if step.Stdin {
+		if err := rt.AttachInput(ctx, id, files); err != nil {
+			return Fail(req.ID, NewExecutionError("attach container input", err))
+		}
+	}
+
+	limitOut := &limitWriter{w: out, limit: int64(step.NOutput)}
+	limitErr := &limitWriter{w: errOut, limit: int64(step.NOutput)}
+
+	stdoutR, stderrR, err := rt.Logs(ctx, id, true)
+	if err != nil {
+		return Fail(req.ID, NewExecutionError("stream container output", err))
+	}
+	defer stdoutR.Close()
+	defer stderrR.Close()
+
+	copyDone := make(chan error, 2)
+	go func() { _, err := io.Copy(limitOut, stdoutR); copyDone <- err }()
+	go func() { _, err := io.Copy(limitErr, stderrR); copyDone <- err }()
+
+	waitDone := make(chan waitResult, 1)
+	go func() {
+		code, err := rt.Wait(ctx, id)
+		waitDone <- waitResult{code, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		if step.Action == actionRun {
+			go func() {
+				killCtx, killCancel := context.WithTimeout(context.Background(), killTimeout)
+				defer killCancel()
+				rt.Kill(killCtx, id)
+			}()
+		}
+		return Fail(req.ID, ErrTimeout)
+	case result := <-waitDone:
+		<-copyDone
+		<-copyDone
+		if result.err != nil {
+			return Fail(req.ID, NewExecutionError("execute code", result.err))
+		}
+		if result.code != 0 {
+			return Fail(req.ID, execExitError{code: result.code})
+		}
+		return Execution{ID: req.ID, OK: true}
+	}
+}
+
+// execStreamInto runs an actionExec step against its named container
+// and relays the result to out/errOut, mirroring Docker.run's exec
+// branch for the streaming path.
+func (e *Docker) execStreamInto(ctx context.Context, rt ContainerRuntime, step *config.Step, req Request, files Files, out io.Writer, errOut io.Writer) Execution {
+	stdout, stderr, err := rt.Exec(ctx, step.Box, step, files)
+	io.WriteString(out, stdout)
+	io.WriteString(errOut, stderr)
+
+	if err == nil {
+		return Execution{ID: req.ID, OK: true, Stdout: stdout, Stderr: stderr}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return Fail(req.ID, ErrTimeout)
+	}
+	var exitErr execExitError
+	if errors.As(err, &exitErr) {
+		return Fail(req.ID, exitErr)
+	}
+	return Fail(req.ID, NewExecutionError("execute code", err))
+}
+
+// waitResult carries a container's exit code (or wait error) from the
+// background goroutine that awaits it back to the select above.
+type waitResult struct {
+	code int
+	err  error
+}
+
+// limitWriter forwards writes to w until limit bytes have passed
+// through, then silently discards the rest - the streaming equivalent
+// of limitBuffer's cap on step.NOutput.
+type limitWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.n >= l.limit {
+		return len(p), nil
+	}
+	if l.limit > 0 && l.n+int64(len(p)) > l.limit {
+		p = p[:l.limit-l.n]
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}